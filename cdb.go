@@ -9,37 +9,50 @@ package cdb
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"hash"
 	"io"
 	"os"
 )
 
-const indexSize = 256 * 8
-
 type index [256]table
 
 // CDB represents an open CDB database. It can only be used for reads; to
 // create a database, use Writer.
 type CDB struct {
-	reader io.ReaderAt
+	reader      io.ReaderAt
 	readerBytes []byte
-	hasher func ([]byte) (uint32)
-	index  index
+	unmap       func() error
+	hasher      func([]byte) uint32
+	format      Format
+	index       index
+	chd         *chdIndex
 }
 
+// table describes one of the 256 top-level hash table entries: where its
+// slots start, and how many slots it has. It is always held in 64 bits
+// internally; readIndex narrows back down to uint32 arithmetic for the
+// classic on-disk format.
 type table struct {
-	offset uint32
-	length uint32
+	offset uint64
+	length uint64
 }
 
-// Open opens an existing CDB database at the given path.
+// Open opens an existing CDB database at the given path, auto-detecting
+// whether it is a classic or Format64 database.
 func Open(path string) (*CDB, error) {
+	return OpenWithOptions(path, Options{})
+}
+
+// OpenWithOptions is like Open, but lets the caller force a particular
+// Format instead of auto-detecting it from the file header.
+func OpenWithOptions(path string, options Options) (*CDB, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return New(f, nil)
+	return NewFromReaderWithHasherAndOptions(f, nil, options)
 }
 
 // New opens a new CDB instance for the given io.ReaderAt. It can only be used
@@ -49,25 +62,39 @@ func Open(path string) (*CDB, error) {
 // was created with a particular hash function, that same hash function must be
 // passed to New, or the database will return incorrect results.
 func New(reader io.ReaderAt, hasher hash.Hash32) (*CDB, error) {
-	return NewFromReaderWithHasher(reader, adaptHash32 (hasher))
+	return NewFromReaderWithHasher(reader, adaptHash32(hasher))
+}
+
+func NewFromReaderWithHasher(reader io.ReaderAt, hasher func([]byte) uint32) (*CDB, error) {
+	return NewFromReaderWithHasherAndOptions(reader, hasher, Options{})
 }
 
-func NewFromReaderWithHasher(reader io.ReaderAt, hasher func ([]byte) (uint32)) (*CDB, error) {
+// NewFromReaderWithHasherAndOptions is like NewFromReaderWithHasher, but
+// lets the caller force a particular Format instead of auto-detecting it
+// from the reader's header.
+func NewFromReaderWithHasherAndOptions(reader io.ReaderAt, hasher func([]byte) uint32, options Options) (*CDB, error) {
 	cdb := &CDB{reader: reader}
-	return cdb.initialize(hasher)
+	return cdb.initialize(hasher, options)
 }
 
-func NewFromBufferWithHasher(buffer []byte, hasher func ([]byte) (uint32)) (*CDB, error) {
+func NewFromBufferWithHasher(buffer []byte, hasher func([]byte) uint32) (*CDB, error) {
+	return NewFromBufferWithHasherAndOptions(buffer, hasher, Options{})
+}
+
+// NewFromBufferWithHasherAndOptions is like NewFromBufferWithHasher, but
+// lets the caller force a particular Format instead of auto-detecting it
+// from the buffer's header.
+func NewFromBufferWithHasherAndOptions(buffer []byte, hasher func([]byte) uint32, options Options) (*CDB, error) {
 	cdb := &CDB{readerBytes: buffer}
-	return cdb.initialize(hasher)
+	return cdb.initialize(hasher, options)
 }
 
-func adaptHash32(hasher hash.Hash32) (func ([]byte) (uint32)) {
-	var hasherFunc func ([]byte) (uint32)
+func adaptHash32(hasher hash.Hash32) func([]byte) uint32 {
+	var hasherFunc func([]byte) uint32
 	if hasher == nil {
 		hasherFunc = nil
 	} else {
-		hasherFunc = func (data []byte) (uint32) {
+		hasherFunc = func(data []byte) uint32 {
 			hasher.Reset()
 			hasher.Write(data)
 			return hasher.Sum32()
@@ -76,20 +103,89 @@ func adaptHash32(hasher hash.Hash32) (func ([]byte) (uint32)) {
 	return hasherFunc
 }
 
-func (cdb *CDB) initialize (hasher func ([]byte) (uint32)) (*CDB, error) {
+func (cdb *CDB) initialize(hasher func([]byte) uint32, options Options) (*CDB, error) {
+	format, err := cdb.detectFormat(options.Format)
+	if err != nil {
+		return nil, err
+	}
+	cdb.format = format
+
+	if options.Verify {
+		if err := cdb.verifyChecksum(); err != nil {
+			return nil, err
+		}
+	}
+
 	if hasher == nil {
-		hasher = CDBHashSum32
+		hasher, err = cdb.resolveHasher()
+		if err != nil {
+			return nil, err
+		}
 	}
 	cdb.hasher = hasher
-	err := cdb.readIndex()
+
+	err = cdb.readIndex()
 	if err != nil {
 		return nil, err
 	}
 	return cdb, nil
 }
 
+// detectFormat honors an explicitly requested format, or otherwise reads
+// enough of the header to recognize a Format64 or FormatCHD database (by
+// their distinct magic prefixes) versus a classic one (which has none).
+func (cdb *CDB) detectFormat(requested Format) (Format, error) {
+	if requested != FormatAuto {
+		return requested, nil
+	}
+
+	prefix, err := cdb.readAt(0, v2MagicPrefixSize)
+	if err != nil {
+		// Shorter than any magic header; treat as classic and let
+		// readIndex surface any real error when it reads the index.
+		return FormatClassic, nil
+	}
+	if bytes.Equal(prefix, v2MagicPrefix[:]) {
+		return Format64, nil
+	}
+	if bytes.Equal(prefix, chdMagicPrefix[:]) {
+		return FormatCHD, nil
+	}
+	return FormatClassic, nil
+}
+
+// resolveHasher picks a hasher when the caller didn't supply one to New.
+// FormatClassic has no room to record which hasher built it, so it
+// defaults to CDBHashSum32 as documented on New. Format64 and FormatCHD
+// both record the hasher's HasherRegistry ID in their header, so it is
+// picked up automatically, falling back to CDBHashSum32 if the ID isn't
+// registered.
+func (cdb *CDB) resolveHasher() (func([]byte) uint32, error) {
+	var idOffset uint64
+	switch cdb.format {
+	case Format64:
+		idOffset = v2HashIDOffset
+	case FormatCHD:
+		idOffset = chdHashIDOffset
+	default:
+		return CDBHashSum32, nil
+	}
+
+	id, err := cdb.readAt(idOffset, 1)
+	if err != nil {
+		return nil, err
+	}
+	if fn, ok := lookupHasherByID(id[0]); ok {
+		return fn, nil
+	}
+	return CDBHashSum32, nil
+}
+
 // Get returns the value for a given key, or nil if it can't be found.
 func (cdb *CDB) Get(key []byte) ([]byte, error) {
+	if cdb.format == FormatCHD {
+		return cdb.getCHD(key)
+	}
 	hash := cdb.hasher(key)
 	return cdb.GetWithHash(key, hash)
 }
@@ -99,7 +195,14 @@ func (cdb *CDB) GetWithCdbHash(key []byte) ([]byte, error) {
 	return cdb.GetWithHash(key, hash)
 }
 
+// GetWithHash looks up key via the classic probed hash table that hashed
+// to hash. It is not supported for a FormatCHD database, whose lookup
+// instead depends on three hashes derived from the registered hasher;
+// use Get there.
 func (cdb *CDB) GetWithHash(key []byte, hash uint32) ([]byte, error) {
+	if cdb.format == FormatCHD {
+		return nil, fmt.Errorf("cdb: GetWithHash is not supported for FormatCHD databases, use Get")
+	}
 
 	table := cdb.index[hash&0xff]
 	if table.length == 0 {
@@ -107,12 +210,13 @@ func (cdb *CDB) GetWithHash(key []byte, hash uint32) ([]byte, error) {
 	}
 
 	// Probe the given hash table, starting at the given slot.
-	startingSlot := (hash >> 8) % table.length
+	startingSlot := uint64(hash>>8) % table.length
 	slot := startingSlot
 
+	slotSize := cdb.format.slotSize()
 	for {
-		slotOffset := table.offset + (8 * slot)
-		slotHash, offset, err := cdb.readTuple(slotOffset)
+		slotOffset := table.offset + (slotSize * slot)
+		slotHash, offset, err := cdb.readSlot(slotOffset)
 		if err != nil {
 			return nil, err
 		}
@@ -120,7 +224,7 @@ func (cdb *CDB) GetWithHash(key []byte, hash uint32) ([]byte, error) {
 		// An empty slot means the key doesn't exist.
 		if slotHash == 0 {
 			break
-		} else if slotHash == hash {
+		} else if slotHash == uint64(hash) {
 			value, err := cdb.getValueAt(offset, key)
 			if err != nil {
 				return nil, err
@@ -138,21 +242,40 @@ func (cdb *CDB) GetWithHash(key []byte, hash uint32) ([]byte, error) {
 	return nil, nil
 }
 
-// Close closes the database to further reads.
+// Close closes the database to further reads. If the database was opened
+// with NewFromMmap, byte slices previously returned by Get or the
+// iterators become invalid once Close returns.
 func (cdb *CDB) Close() error {
-	if cdb.reader == nil {
-		return nil
+	var err error
+
+	if cdb.reader != nil {
+		if closer, ok := cdb.reader.(io.Closer); ok {
+			err = closer.Close()
+		}
 	}
-	if closer, ok := cdb.reader.(io.Closer); ok {
-		return closer.Close()
-	} else {
-		return nil
+
+	if cdb.unmap != nil {
+		if unmapErr := cdb.unmap(); err == nil {
+			err = unmapErr
+		}
 	}
+
+	return err
 }
 
 func (cdb *CDB) readIndex() error {
+	switch cdb.format {
+	case Format64:
+		return cdb.readIndex64()
+	case FormatCHD:
+		return cdb.readCHDIndex()
+	default:
+		return cdb.readIndexClassic()
+	}
+}
 
-	buf, err := cdb.readAt(0, indexSize)
+func (cdb *CDB) readIndexClassic() error {
+	buf, err := cdb.readAt(0, classicIndexSize)
 	if err != nil {
 		return err
 	}
@@ -160,15 +283,62 @@ func (cdb *CDB) readIndex() error {
 	for i := 0; i < 256; i++ {
 		off := i * 8
 		cdb.index[i] = table{
-			offset: binary.LittleEndian.Uint32(buf[off : off+4]),
-			length: binary.LittleEndian.Uint32(buf[off+4 : off+8]),
+			offset: uint64(binary.LittleEndian.Uint32(buf[off : off+4])),
+			length: uint64(binary.LittleEndian.Uint32(buf[off+4 : off+8])),
 		}
 	}
 
 	return nil
 }
 
-func (cdb *CDB) getValueAt(offset uint32, expectedKey []byte) ([]byte, error) {
+func (cdb *CDB) readIndex64() error {
+	buf, err := cdb.readAt(v2MagicSize, v2IndexSize)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < 256; i++ {
+		off := i * 16
+		cdb.index[i] = table{
+			offset: binary.LittleEndian.Uint64(buf[off : off+8]),
+			length: binary.LittleEndian.Uint64(buf[off+8 : off+16]),
+		}
+	}
+
+	return nil
+}
+
+// readSlot reads a single hash table slot at the given offset, returning
+// its stored hash and the offset of the record it points to. The slot
+// width depends on cdb.format: 8 bytes (uint32, uint32) for FormatClassic,
+// 16 bytes (uint64, uint64) for Format64.
+func (cdb *CDB) readSlot(offset uint64) (uint64, uint64, error) {
+	if cdb.format == Format64 {
+		buf, err := cdb.readAt(offset, 16)
+		if err != nil {
+			return 0, 0, err
+		}
+		return binary.LittleEndian.Uint64(buf[0:8]), binary.LittleEndian.Uint64(buf[8:16]), nil
+	}
+
+	buf, err := cdb.readAt(offset, 8)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint64(binary.LittleEndian.Uint32(buf[0:4])), uint64(binary.LittleEndian.Uint32(buf[4:8])), nil
+}
+
+// readTuple reads a record header (keyLength, valueLength) at the given
+// offset. Record headers are always two uint32s, regardless of format.
+func (cdb *CDB) readTuple(offset uint64) (uint32, uint32, error) {
+	buf, err := cdb.readAt(offset, 8)
+	if err != nil {
+		return 0, 0, err
+	}
+	return binary.LittleEndian.Uint32(buf[0:4]), binary.LittleEndian.Uint32(buf[4:8]), nil
+}
+
+func (cdb *CDB) getValueAt(offset uint64, expectedKey []byte) ([]byte, error) {
 	keyLength, valueLength, err := cdb.readTuple(offset)
 	if err != nil {
 		return nil, err
@@ -180,7 +350,7 @@ func (cdb *CDB) getValueAt(offset uint32, expectedKey []byte) ([]byte, error) {
 	}
 
 	var buf []byte
-	buf, err = cdb.readAt(offset+8, keyLength+valueLength)
+	buf, err = cdb.readAt(offset+8, uint64(keyLength)+uint64(valueLength))
 	if err != nil {
 		return nil, err
 	}
@@ -192,3 +362,22 @@ func (cdb *CDB) getValueAt(offset uint32, expectedKey []byte) ([]byte, error) {
 
 	return buf[keyLength:], nil
 }
+
+// readAt reads length bytes at offset, from whichever backing store this
+// CDB was opened with.
+func (cdb *CDB) readAt(offset uint64, length uint64) ([]byte, error) {
+	if cdb.readerBytes != nil {
+		end := offset + length
+		if end > uint64(len(cdb.readerBytes)) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return cdb.readerBytes[offset:end], nil
+	}
+
+	buf := make([]byte, length)
+	_, err := cdb.reader.ReadAt(buf, int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,205 @@
+package cdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// FormatCHD replaces the classic probed hash tables with a single CHD
+// (Compress-Hash-Displace) perfect hash function over the database's key
+// set: the n keys are bucketed by h0(key) mod r, and each bucket is
+// assigned a displacement seed such that combining it with h1(key) and
+// h2(key) places every key in the bucket into a distinct, otherwise-empty
+// slot of an m-slot table. m is 2n, so the hash is perfect (no two keys
+// share a slot) but not minimal: half the slots stay empty. A lookup computes its bucket,
+// loads that bucket's seed, and reads one slot — no probing.
+//
+// The three hashes are derived from the database's single registered
+// 32-bit hasher by hashing a one-byte seed prefixed to the key, rather
+// than requiring three independent hash functions.
+const (
+	chdMagicPrefixSize = 7
+	chdMagicSize       = 8 // prefix, plus a 1-byte hasher ID
+	chdHashIDOffset    = chdMagicPrefixSize
+	chdHeaderSize      = chdMagicSize + 16 // + (chd section offset, length uint64)
+	chdLambda          = 4
+	chdMaxSeed         = 1 << 20
+)
+
+// chdMagicPrefix is written at the very start of every FormatCHD
+// database, distinguishing it from both a classic database (which has no
+// magic) and a Format64 one (which starts with v2MagicPrefix instead).
+var chdMagicPrefix = [chdMagicPrefixSize]byte{'C', 'D', 'B', 'C', 'H', 'D', 0}
+
+// chdIndex is the decoded form of the CHD section written after the data
+// records: r buckets, an m-slot table, one displacement seed per bucket,
+// and the record offset (or 0 for empty) in each slot.
+type chdIndex struct {
+	r             uint64
+	m             uint64
+	seeds         []uint32
+	slots         []uint64
+	sectionOffset uint64
+}
+
+// chdHash derives one of the CHD construction's three hashes from the
+// database's hasher by hashing seed prefixed to key.
+func chdHash(hasher func([]byte) uint32, seed byte, key []byte) uint32 {
+	buf := make([]byte, len(key)+1)
+	buf[0] = seed
+	copy(buf[1:], key)
+	return hasher(buf)
+}
+
+func (cdb *CDB) readCHDIndex() error {
+	ptr, err := cdb.readAt(chdMagicSize, 16)
+	if err != nil {
+		return err
+	}
+	sectionOffset := binary.LittleEndian.Uint64(ptr[0:8])
+	sectionLength := binary.LittleEndian.Uint64(ptr[8:16])
+
+	buf, err := cdb.readAt(sectionOffset, sectionLength)
+	if err != nil {
+		return err
+	}
+
+	if len(buf) < 16 {
+		return io.ErrUnexpectedEOF
+	}
+	r := binary.LittleEndian.Uint64(buf[0:8])
+	m := binary.LittleEndian.Uint64(buf[8:16])
+
+	if 16+r*4+m*8 > uint64(len(buf)) {
+		return io.ErrUnexpectedEOF
+	}
+
+	off := uint64(16)
+	seeds := make([]uint32, r)
+	for i := uint64(0); i < r; i++ {
+		seeds[i] = binary.LittleEndian.Uint32(buf[off : off+4])
+		off += 4
+	}
+
+	slots := make([]uint64, m)
+	for i := uint64(0); i < m; i++ {
+		slots[i] = binary.LittleEndian.Uint64(buf[off : off+8])
+		off += 8
+	}
+
+	cdb.chd = &chdIndex{r: r, m: m, seeds: seeds, slots: slots, sectionOffset: sectionOffset}
+	return nil
+}
+
+// getCHD looks up key via the CHD index, falling back to nil (not
+// found) for an empty database. It still compares the stored key against
+// key via getValueAt, since a perfect hash only guarantees no collisions among
+// the keys it was built from — a key outside that set can still map to
+// an occupied slot.
+func (cdb *CDB) getCHD(key []byte) ([]byte, error) {
+	if cdb.chd == nil || cdb.chd.r == 0 {
+		return nil, nil
+	}
+
+	h0 := uint64(chdHash(cdb.hasher, 0, key)) % cdb.chd.r
+	seed := cdb.chd.seeds[h0]
+	h1 := uint64(chdHash(cdb.hasher, 1, key))
+	h2 := uint64(chdHash(cdb.hasher, 2, key))
+	slot := (h1 + uint64(seed)*h2) % cdb.chd.m
+
+	offset := cdb.chd.slots[slot]
+	if offset == 0 {
+		return nil, nil
+	}
+	return cdb.getValueAt(offset, key)
+}
+
+// chdEntry is a pending key/offset pair, recorded by Put while
+// Writer.UseCHDIndex is enabled and consumed by buildCHDIndex at Close.
+type chdEntry struct {
+	key    []byte
+	offset uint64
+}
+
+// buildCHDIndex constructs a perfect hash (2n slots, not minimal) over entries following
+// the bucket-then-displace scheme described above, bucketing keys by
+// descending bucket size first so the hardest-to-place buckets get first
+// pick of slots.
+func buildCHDIndex(hasher func([]byte) uint32, entries []chdEntry) (*chdIndex, error) {
+	n := uint64(len(entries))
+	if n == 0 {
+		return &chdIndex{}, nil
+	}
+
+	r := n / chdLambda
+	if r == 0 {
+		r = 1
+	}
+	m := n * 2
+
+	type keyHashes struct {
+		h1, h2, offset uint64
+	}
+
+	buckets := make([][]keyHashes, r)
+	for _, e := range entries {
+		h0 := uint64(chdHash(hasher, 0, e.key)) % r
+		h1 := uint64(chdHash(hasher, 1, e.key))
+		h2 := uint64(chdHash(hasher, 2, e.key))
+		buckets[h0] = append(buckets[h0], keyHashes{h1: h1, h2: h2, offset: e.offset})
+	}
+
+	order := make([]int, r)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return len(buckets[order[i]]) > len(buckets[order[j]])
+	})
+
+	seeds := make([]uint32, r)
+	slots := make([]uint64, m)
+	occupied := make([]bool, m)
+
+	for _, bi := range order {
+		bucket := buckets[bi]
+		if len(bucket) == 0 {
+			continue
+		}
+
+		positions := make([]uint64, len(bucket))
+		seed := uint32(0)
+		for {
+			if seed > chdMaxSeed {
+				return nil, fmt.Errorf("cdb: CHD construction failed to place bucket %d after %d displacement attempts", bi, chdMaxSeed)
+			}
+
+			collided := false
+			seen := make(map[uint64]bool, len(bucket))
+			for i, kh := range bucket {
+				pos := (kh.h1 + uint64(seed)*kh.h2) % m
+				if occupied[pos] || seen[pos] {
+					collided = true
+					break
+				}
+				seen[pos] = true
+				positions[i] = pos
+			}
+			if collided {
+				seed++
+				continue
+			}
+
+			for i, kh := range bucket {
+				occupied[positions[i]] = true
+				slots[positions[i]] = kh.offset
+			}
+			seeds[bi] = seed
+			break
+		}
+	}
+
+	return &chdIndex{r: r, m: m, seeds: seeds, slots: slots}, nil
+}
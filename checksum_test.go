@@ -0,0 +1,101 @@
+package cdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestChecksumVerifyRoundTrip checks that a database built with
+// UseChecksum opens successfully with Options.Verify, and that Open
+// rejects it once a single byte in the body is corrupted.
+func TestChecksumVerifyRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	w.UseChecksum(true)
+	if err := w.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := w.Freeze(); err != nil {
+		t.Fatalf("Freeze: %v", err)
+	}
+
+	db, err := OpenWithOptions(path, Options{Verify: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions(Verify: true): %v", err)
+	}
+	db.Close()
+
+	// Flip a byte inside the data section and confirm Verify notices.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	data[classicIndexSize] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if _, err := OpenWithOptions(path, Options{Verify: true}); err == nil {
+		t.Fatal("OpenWithOptions(Verify: true) on a corrupted database unexpectedly succeeded")
+	}
+}
+
+// TestVerifyChecksumStreamsBody checks that verifying a database doesn't
+// require materializing its whole body into memory in a single read: a
+// reader that fails any ReadAt bigger than 40 KiB (just above io.Copy's
+// default 32 KiB buffer) should still be verifiable against a body well
+// over that size,
+// since hashBody streams it via io.Copy/io.NewSectionReader instead of
+// reading it all in one cdb.readAt call.
+func TestVerifyChecksumStreamsBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	w.UseChecksum(true)
+	value := []byte(strings.Repeat("x", 4096))
+	for i := 0; i < 64; i++ {
+		if err := w.Put([]byte(fmt.Sprintf("key-%d", i)), value); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	if _, err := w.Freeze(); err != nil {
+		t.Fatalf("Freeze: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	capped := &capReaderAt{File: f, maxLen: 40 * 1024}
+	if _, err := NewFromReaderWithHasherAndOptions(capped, nil, Options{Verify: true}); err != nil {
+		t.Fatalf("NewFromReaderWithHasherAndOptions(Verify: true): %v", err)
+	}
+}
+
+// capReaderAt wraps an *os.File and fails any ReadAt asking for more
+// than maxLen bytes, so a caller can't get away with reading a large
+// body into memory in a single call. It forwards Seek so size() can
+// still determine the file's length.
+type capReaderAt struct {
+	*os.File
+	maxLen int
+}
+
+func (c *capReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) > c.maxLen {
+		return 0, fmt.Errorf("capReaderAt: refusing to read %d bytes at once (cap %d)", len(p), c.maxLen)
+	}
+	return c.File.ReadAt(p, off)
+}
@@ -0,0 +1,99 @@
+package cdb
+
+// Format identifies the on-disk layout of a CDB database.
+//
+// FormatAuto (the zero value) tells Open and the NewFrom* constructors to
+// detect the format from the file's header. It has no meaning for a
+// Writer, which must be told explicitly which format to produce; there,
+// FormatAuto is treated as FormatClassic.
+type Format int
+
+const (
+	FormatAuto Format = iota
+
+	// FormatClassic is the original cdb format: a 2048-byte index of
+	// (offset, length uint32) pairs, followed by 256 hash tables whose
+	// slots are (hash, offset uint32) pairs. Files are limited to just
+	// under 4 GiB.
+	FormatClassic
+
+	// Format64 widens the index and hash table slots to 64 bits,
+	// removing the classic format's 4 GiB file size limit. A Format64
+	// database starts with an 8-byte magic header, followed by a
+	// 4096-byte index of (offset, length uint64) pairs.
+	Format64
+
+	// FormatCHD replaces the 256 hash tables with a single CHD
+	// (Compress-Hash-Displace) perfect hash over the database's key set
+	// (with twice as many slots as keys, so not minimal), giving
+	// guaranteed single-probe lookups. It is produced by
+	// a Writer with UseCHDIndex enabled; see chd.go.
+	FormatCHD
+)
+
+// Options configures how a database is opened or created.
+type Options struct {
+	// Format selects the on-disk layout. For Open and the NewFrom*
+	// constructors, leaving this as FormatAuto (the default) detects the
+	// format from the file header. For a Writer, Format must be
+	// FormatClassic or Format64; FormatAuto is treated as FormatClassic.
+	Format Format
+
+	// HasherName selects a hasher from HasherRegistry by name, for a
+	// Writer. It is ignored when opening a database: FormatClassic
+	// databases always default to CDBHashSum32 unless an explicit
+	// hash.Hash32 is passed to New, and Format64 databases record the
+	// hasher they were built with and select it automatically.
+	HasherName string
+
+	// Verify checks the checksum trailer written by a Writer with
+	// UseChecksum enabled: OpenWithOptions or a New*AndOptions constructor
+	// re-hashes the file and returns an error if it doesn't match the
+	// trailer, before returning the *CDB.
+	// It is ignored for a Writer.
+	Verify bool
+}
+
+const (
+	classicIndexSize  = 256 * 8  // 256 slots * (uint32 offset, uint32 length)
+	v2IndexSize       = 256 * 16 // 256 slots * (uint64 offset, uint64 length)
+	v2MagicPrefixSize = 7
+	v2MagicSize       = 8 // prefix, plus a 1-byte hasher ID from HasherRegistry
+	v2HashIDOffset    = v2MagicPrefixSize
+	v2HeaderSize      = v2MagicSize + v2IndexSize
+)
+
+// v2MagicPrefix is written at the very start of every Format64 database,
+// followed by a 1-byte hasher ID and then its 4096-byte index. Classic
+// databases have no such header and start their index at offset 0, which
+// is what lets Open tell the two formats apart.
+var v2MagicPrefix = [v2MagicPrefixSize]byte{'C', 'D', 'B', '6', '4', 0, 0}
+
+func (f Format) slotSize() uint64 {
+	if f == Format64 {
+		return 16
+	}
+	return 8
+}
+
+func (f Format) indexSize() uint64 {
+	if f == Format64 {
+		return v2IndexSize
+	}
+	return classicIndexSize
+}
+
+// headerSize is the number of bytes reserved at the start of the file
+// before the first record: just the index for a classic database, the
+// magic plus index for a Format64 one, or the small fixed CHD pointer
+// header (see chd.go) for a FormatCHD one.
+func (f Format) headerSize() uint64 {
+	switch f {
+	case Format64:
+		return v2HeaderSize
+	case FormatCHD:
+		return chdHeaderSize
+	default:
+		return classicIndexSize
+	}
+}
@@ -0,0 +1,72 @@
+package cdb
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestFormat64RoundTrip checks that a database built with
+// Options{Format: Format64} round-trips through Open's auto-detection,
+// which tells the two formats apart by v2MagicPrefix.
+func TestFormat64RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cdb")
+
+	w, err := CreateWithOptions(path, Options{Format: Format64})
+	if err != nil {
+		t.Fatalf("CreateWithOptions: %v", err)
+	}
+	if err := w.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := w.Freeze(); err != nil {
+		t.Fatalf("Freeze: %v", err)
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	if db.format != Format64 {
+		t.Fatalf("Open auto-detected format %v, want Format64", db.format)
+	}
+
+	value, err := db.Get([]byte("k"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(value) != "v" {
+		t.Fatalf("Get(k) = %q, want %q", value, "v")
+	}
+}
+
+// TestOpenAutoDetectsClassicFormat checks that a database built without
+// an explicit Format still opens as FormatClassic, since it has no
+// Format64 magic header.
+func TestOpenAutoDetectsClassicFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := w.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	frozen, err := w.Freeze()
+	if err != nil {
+		t.Fatalf("Freeze: %v", err)
+	}
+	frozen.Close()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	if db.format != FormatClassic {
+		t.Fatalf("Open auto-detected format %v, want FormatClassic", db.format)
+	}
+}
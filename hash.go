@@ -0,0 +1,281 @@
+package cdb
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"hash/fnv"
+	"math/bits"
+	"sync"
+)
+
+// CDBHashSum32 is the hash function described by the original cdb spec:
+// h = 5381, then h = ((h << 5) + h) ^ c for every byte c. It is the
+// default used by New and Writer when no other hasher is requested.
+func CDBHashSum32(data []byte) uint32 {
+	var h uint32 = 5381
+	for _, c := range data {
+		h = ((h << 5) + h) ^ uint32(c)
+	}
+	return h
+}
+
+// FNV1aHashSum32 hashes data with 32-bit FNV-1a.
+func FNV1aHashSum32(data []byte) uint32 {
+	h := fnv.New32a()
+	h.Write(data)
+	return h.Sum32()
+}
+
+// FNV1HashSum32 hashes data with 32-bit FNV-1.
+func FNV1HashSum32(data []byte) uint32 {
+	h := fnv.New32()
+	h.Write(data)
+	return h.Sum32()
+}
+
+// CRC32IEEEHashSum32 hashes data with the IEEE CRC-32 polynomial.
+func CRC32IEEEHashSum32(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data)
+}
+
+var crc32CastagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CRC32CastagnoliHashSum32 hashes data with the Castagnoli CRC-32
+// polynomial (as used by SSE 4.2 and ext4).
+func CRC32CastagnoliHashSum32(data []byte) uint32 {
+	return crc32.Checksum(data, crc32CastagnoliTable)
+}
+
+// Murmur3HashSum32 hashes data with the x86 32-bit variant of MurmurHash3,
+// seeded with 0.
+func Murmur3HashSum32(data []byte) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	var h uint32
+	nblocks := len(data) / 4
+
+	for i := 0; i < nblocks; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	switch tail := data[nblocks*4:]; len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
+
+const (
+	xxh32Prime1 uint32 = 2654435761
+	xxh32Prime2 uint32 = 2246822519
+	xxh32Prime3 uint32 = 3266489917
+	xxh32Prime4 uint32 = 668265263
+	xxh32Prime5 uint32 = 374761393
+)
+
+func xxh32Round(acc, input uint32) uint32 {
+	acc += input * xxh32Prime2
+	acc = bits.RotateLeft32(acc, 13)
+	acc *= xxh32Prime1
+	return acc
+}
+
+// XXH32HashSum32 hashes data with xxHash32, seeded with 0.
+func XXH32HashSum32(data []byte) uint32 {
+	n := len(data)
+	i := 0
+
+	var h uint32
+	if n >= 16 {
+		p1, p2 := xxh32Prime1, xxh32Prime2
+		v1 := p1 + p2
+		v2 := p2
+		v3 := uint32(0)
+		v4 := uint32(0) - p1
+
+		for ; i+16 <= n; i += 16 {
+			v1 = xxh32Round(v1, binary.LittleEndian.Uint32(data[i:]))
+			v2 = xxh32Round(v2, binary.LittleEndian.Uint32(data[i+4:]))
+			v3 = xxh32Round(v3, binary.LittleEndian.Uint32(data[i+8:]))
+			v4 = xxh32Round(v4, binary.LittleEndian.Uint32(data[i+12:]))
+		}
+
+		h = bits.RotateLeft32(v1, 1) + bits.RotateLeft32(v2, 7) + bits.RotateLeft32(v3, 12) + bits.RotateLeft32(v4, 18)
+	} else {
+		h = xxh32Prime5
+	}
+
+	h += uint32(n)
+
+	for ; i+4 <= n; i += 4 {
+		h += binary.LittleEndian.Uint32(data[i:]) * xxh32Prime3
+		h = bits.RotateLeft32(h, 17) * xxh32Prime4
+	}
+
+	for ; i < n; i++ {
+		h += uint32(data[i]) * xxh32Prime5
+		h = bits.RotateLeft32(h, 11) * xxh32Prime1
+	}
+
+	h ^= h >> 15
+	h *= xxh32Prime2
+	h ^= h >> 13
+	h *= xxh32Prime3
+	h ^= h >> 16
+
+	return h
+}
+
+// SuperFastHashSum32 hashes data with Paul Hsieh's SuperFastHash.
+func SuperFastHashSum32(data []byte) uint32 {
+	n := len(data)
+	if n == 0 {
+		return 0
+	}
+
+	hash := uint32(n)
+	i := 0
+
+	remaining := n
+	for ; remaining >= 4; remaining -= 4 {
+		hash += uint32(binary.LittleEndian.Uint16(data[i:]))
+		tmp := (uint32(binary.LittleEndian.Uint16(data[i+2:])) << 11) ^ hash
+		hash = (hash << 16) ^ tmp
+		hash += hash >> 11
+		i += 4
+	}
+
+	switch remaining {
+	case 3:
+		hash += uint32(binary.LittleEndian.Uint16(data[i:]))
+		hash ^= hash << 16
+		hash ^= uint32(data[i+2]) << 18
+		hash += hash >> 11
+	case 2:
+		hash += uint32(binary.LittleEndian.Uint16(data[i:]))
+		hash ^= hash << 11
+		hash += hash >> 17
+	case 1:
+		hash += uint32(data[i])
+		hash ^= hash << 10
+		hash += hash >> 1
+	}
+
+	hash ^= hash << 3
+	hash += hash >> 5
+	hash ^= hash << 4
+	hash += hash >> 17
+	hash ^= hash << 25
+	hash += hash >> 6
+
+	return hash
+}
+
+var (
+	hasherMu       sync.RWMutex
+	hasherByName   = map[string]func([]byte) uint32{}
+	hasherIDByName = map[string]byte{}
+	hasherByID     = map[byte]func([]byte) uint32{}
+	nextHasherID   byte
+)
+
+func registerHasherLocked(name string, fn func([]byte) uint32) {
+	id := nextHasherID
+	nextHasherID++
+	hasherByName[name] = fn
+	hasherIDByName[name] = id
+	hasherByID[id] = fn
+}
+
+func init() {
+	registerHasherLocked("cdb", CDBHashSum32)
+	registerHasherLocked("fnv1a", FNV1aHashSum32)
+	registerHasherLocked("fnv1", FNV1HashSum32)
+	registerHasherLocked("crc32-ieee", CRC32IEEEHashSum32)
+	registerHasherLocked("crc32-castagnoli", CRC32CastagnoliHashSum32)
+	registerHasherLocked("murmur3", Murmur3HashSum32)
+	registerHasherLocked("xxh32", XXH32HashSum32)
+	registerHasherLocked("superfasthash", SuperFastHashSum32)
+}
+
+// RegisterHasher adds a user-supplied hash function to the hasher
+// registry under name, making it selectable via Options.HasherName and,
+// for Format64 databases, recognizable by Open when reading back a
+// database that recorded it.
+func RegisterHasher(name string, fn func([]byte) uint32) {
+	hasherMu.Lock()
+	defer hasherMu.Unlock()
+	registerHasherLocked(name, fn)
+}
+
+// HasherRegistry returns a snapshot of the short hash names mapped to the
+// function that implements them, preloaded with the hashers above and
+// anything added with RegisterHasher. The returned map is a copy, safe
+// to range over even while RegisterHasher runs concurrently.
+func HasherRegistry() map[string]func([]byte) uint32 {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	out := make(map[string]func([]byte) uint32, len(hasherByName))
+	for name, fn := range hasherByName {
+		out[name] = fn
+	}
+	return out
+}
+
+// lookupHasherByName returns the hasher registered under name, and
+// whether it was found, taking hasherMu for the duration of the lookup.
+func lookupHasherByName(name string) (func([]byte) uint32, bool) {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	fn, ok := hasherByName[name]
+	return fn, ok
+}
+
+// lookupHasherIDByName returns the registry ID for the hasher registered
+// under name, and whether it was found, taking hasherMu for the
+// duration of the lookup.
+func lookupHasherIDByName(name string) (byte, bool) {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	id, ok := hasherIDByName[name]
+	return id, ok
+}
+
+// lookupHasherByID returns the hasher registered under the given
+// registry ID, and whether it was found, taking hasherMu for the
+// duration of the lookup.
+func lookupHasherByID(id byte) (func([]byte) uint32, bool) {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	fn, ok := hasherByID[id]
+	return fn, ok
+}
@@ -0,0 +1,60 @@
+package cdb
+
+import "testing"
+
+// TestXXH32HashSum32EmptyInput pins XXH32HashSum32 against the reference
+// xxHash32 test vector for an empty input at seed 0, guarding against a
+// regression of the xxh32Prime1/xxh32Prime2 constant-overflow compile
+// failure this hasher once had.
+func TestXXH32HashSum32EmptyInput(t *testing.T) {
+	const want = 0x02CC5D05
+	if got := XXH32HashSum32(nil); got != want {
+		t.Fatalf("XXH32HashSum32(nil) = %#x, want %#x", got, want)
+	}
+}
+
+// TestHashersAreDeterministic checks that every preregistered hasher
+// returns the same value for the same input, and (for non-empty input)
+// a different value for different input.
+func TestHashersAreDeterministic(t *testing.T) {
+	hashers := HasherRegistry()
+	if len(hashers) == 0 {
+		t.Fatal("HasherRegistry() returned no hashers")
+	}
+
+	a := []byte("the quick brown fox")
+	b := []byte("jumps over the lazy dog")
+
+	for name, fn := range hashers {
+		if fn(a) != fn(a) {
+			t.Errorf("hasher %q is not deterministic", name)
+		}
+		if fn(a) == fn(b) {
+			t.Errorf("hasher %q hashed two different inputs to the same value", name)
+		}
+	}
+}
+
+func TestRegisterHasher(t *testing.T) {
+	called := false
+	RegisterHasher("test-hasher-register", func(data []byte) uint32 {
+		called = true
+		return 42
+	})
+
+	fn, ok := lookupHasherByName("test-hasher-register")
+	if !ok {
+		t.Fatal("RegisterHasher did not make the hasher findable by name")
+	}
+	if got := fn(nil); got != 42 {
+		t.Fatalf("registered hasher returned %d, want 42", got)
+	}
+	if !called {
+		t.Fatal("registered hasher was never invoked")
+	}
+
+	reg := HasherRegistry()
+	if _, ok := reg["test-hasher-register"]; !ok {
+		t.Fatal("HasherRegistry() snapshot does not include a hasher just registered")
+	}
+}
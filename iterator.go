@@ -0,0 +1,173 @@
+package cdb
+
+import (
+	"bytes"
+	"io"
+)
+
+// dataEnd returns the offset where the data section ends, i.e. the start
+// of the earliest non-empty hash table (or, for a FormatCHD database,
+// the start of its CHD section). Records are always written before any
+// index structure, so this is also one past the last record.
+func (cdb *CDB) dataEnd() uint64 {
+	if cdb.format == FormatCHD {
+		if cdb.chd == nil {
+			return cdb.format.headerSize()
+		}
+		return cdb.chd.sectionOffset
+	}
+
+	end := ^uint64(0)
+	for _, t := range cdb.index {
+		if t.length == 0 {
+			continue
+		}
+		if t.offset < end {
+			end = t.offset
+		}
+	}
+	if end == ^uint64(0) {
+		return cdb.format.headerSize()
+	}
+	return end
+}
+
+// readerAt returns an io.ReaderAt over whichever backing store this CDB
+// was opened with, wrapping readerBytes in a bytes.Reader when the CDB
+// was opened from an in-memory buffer.
+func (cdb *CDB) readerAt() io.ReaderAt {
+	if cdb.reader != nil {
+		return cdb.reader
+	}
+	return bytes.NewReader(cdb.readerBytes)
+}
+
+// Iterator sequentially yields every (key, value) pair stored in a
+// database, in the order they were written.
+type Iterator struct {
+	cdb   *CDB
+	pos   uint64
+	end   uint64
+	key   []byte
+	value []byte
+	err   error
+	done  bool
+}
+
+// Iterator returns an Iterator over every record in cdb, in insertion
+// order.
+func (cdb *CDB) Iterator() *Iterator {
+	return &Iterator{cdb: cdb, pos: cdb.format.headerSize(), end: cdb.dataEnd()}
+}
+
+// Next advances the iterator to the next record, returning false once
+// there are no more records or an error has occurred.
+func (it *Iterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	if it.pos >= it.end {
+		it.done = true
+		return false
+	}
+
+	keyLength, valueLength, err := it.cdb.readTuple(it.pos)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	buf, err := it.cdb.readAt(it.pos+8, uint64(keyLength)+uint64(valueLength))
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.key = buf[:keyLength]
+	it.value = buf[keyLength:]
+	it.pos += 8 + uint64(keyLength) + uint64(valueLength)
+	return true
+}
+
+// Key returns the key of the current record.
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the value of the current record.
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// Err returns the first error encountered during iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// LazyIterator is like Iterator, but only reads the key of each record
+// eagerly. The value is exposed as a streaming io.Reader via
+// ValueReader, so large values don't need to be read into memory to skip
+// past them.
+type LazyIterator struct {
+	cdb         *CDB
+	pos         uint64
+	end         uint64
+	key         []byte
+	valueOffset uint64
+	valueLength uint32
+	err         error
+	done        bool
+}
+
+// LazyIterator returns a LazyIterator over every record in cdb, in
+// insertion order.
+func (cdb *CDB) LazyIterator() *LazyIterator {
+	return &LazyIterator{cdb: cdb, pos: cdb.format.headerSize(), end: cdb.dataEnd()}
+}
+
+// Next advances the iterator to the next record, returning false once
+// there are no more records or an error has occurred.
+func (it *LazyIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	if it.pos >= it.end {
+		it.done = true
+		return false
+	}
+
+	keyLength, valueLength, err := it.cdb.readTuple(it.pos)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	key, err := it.cdb.readAt(it.pos+8, uint64(keyLength))
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.key = key
+	it.valueOffset = it.pos + 8 + uint64(keyLength)
+	it.valueLength = valueLength
+	it.pos = it.valueOffset + uint64(valueLength)
+	return true
+}
+
+// Key returns the key of the current record.
+func (it *LazyIterator) Key() []byte {
+	return it.key
+}
+
+// ValueReader returns a reader over the current record's value without
+// copying it into memory. The returned reader is only valid until the
+// next call to Next.
+func (it *LazyIterator) ValueReader() io.Reader {
+	return io.NewSectionReader(it.cdb.readerAt(), int64(it.valueOffset), int64(it.valueLength))
+}
+
+// Err returns the first error encountered during iteration, if any.
+func (it *LazyIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,98 @@
+package cdb
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// TestIteratorYieldsInsertionOrder checks that Iterator walks every
+// record in the order Put wrote them.
+func TestIteratorYieldsInsertionOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	keys := []string{"a", "b", "c"}
+	values := []string{"1", "2", "3"}
+	for i, key := range keys {
+		if err := w.Put([]byte(key), []byte(values[i])); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	db, err := w.Freeze()
+	if err != nil {
+		t.Fatalf("Freeze: %v", err)
+	}
+	defer db.Close()
+
+	it := db.Iterator()
+	var gotKeys, gotValues []string
+	for it.Next() {
+		gotKeys = append(gotKeys, string(it.Key()))
+		gotValues = append(gotValues, string(it.Value()))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Iterator.Err: %v", err)
+	}
+
+	if len(gotKeys) != len(keys) {
+		t.Fatalf("got %d records, want %d", len(gotKeys), len(keys))
+	}
+	for i := range keys {
+		if gotKeys[i] != keys[i] || gotValues[i] != values[i] {
+			t.Fatalf("record %d = (%q, %q), want (%q, %q)", i, gotKeys[i], gotValues[i], keys[i], values[i])
+		}
+	}
+}
+
+// TestLazyIteratorValueReader checks that LazyIterator exposes each
+// record's value as a readable stream matching the eager Iterator.
+func TestLazyIteratorValueReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := w.Put([]byte("k1"), []byte("hello")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := w.Put([]byte("k2"), []byte("world")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	db, err := w.Freeze()
+	if err != nil {
+		t.Fatalf("Freeze: %v", err)
+	}
+	defer db.Close()
+
+	it := db.LazyIterator()
+	var gotKeys, gotValues []string
+	for it.Next() {
+		value, err := io.ReadAll(it.ValueReader())
+		if err != nil {
+			t.Fatalf("ValueReader: %v", err)
+		}
+		gotKeys = append(gotKeys, string(it.Key()))
+		gotValues = append(gotValues, string(value))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("LazyIterator.Err: %v", err)
+	}
+
+	wantKeys := []string{"k1", "k2"}
+	wantValues := []string{"hello", "world"}
+	if len(gotKeys) != len(wantKeys) {
+		t.Fatalf("got %d records, want %d", len(gotKeys), len(wantKeys))
+	}
+	for i := range wantKeys {
+		if gotKeys[i] != wantKeys[i] || gotValues[i] != wantValues[i] {
+			t.Fatalf("record %d = (%q, %q), want (%q, %q)", i, gotKeys[i], gotValues[i], wantKeys[i], wantValues[i])
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package cdb
+
+import "os"
+
+// NewFromMmap opens the database at path by mapping the whole file into
+// memory, so that Get and the iterators can return sub-slices of the
+// mapped region through the readerBytes fast path instead of copying.
+//
+// The returned CDB must be closed with Close before the underlying file
+// is removed or truncated, and any byte slice it returned becomes
+// invalid once Close has been called.
+func NewFromMmap(path string) (*CDB, error) {
+	return NewFromMmapWithHasherAndOptions(path, nil, Options{})
+}
+
+// NewFromMmapWithHasherAndOptions is like NewFromMmap, but lets the
+// caller supply a hash function and force a particular Format instead of
+// auto-detecting it from the file header.
+func NewFromMmapWithHasherAndOptions(path string, hasher func([]byte) uint32, options Options) (*CDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	data, unmap, err := mmapFile(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	cdb := &CDB{readerBytes: data, unmap: unmap}
+	result, err := cdb.initialize(hasher, options)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package cdb
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestNewFromMmapRoundTrip checks that a database built with Create can
+// be read back through NewFromMmap, and that the returned values are
+// still valid until Close unmaps them.
+func TestNewFromMmapRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := w.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	db, err := NewFromMmap(path)
+	if err != nil {
+		t.Fatalf("NewFromMmap: %v", err)
+	}
+
+	value, err := db.Get([]byte("k"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(value) != "v" {
+		t.Fatalf("Get(k) = %q, want %q", value, "v")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package cdb
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the whole of f into memory read-only and returns the
+// mapped bytes along with a function that unmaps them.
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	if size == 0 {
+		return []byte{}, func() error { return nil }, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unmapped := false
+	unmap := func() error {
+		if unmapped {
+			return nil
+		}
+		unmapped = true
+		return syscall.Munmap(data)
+	}
+
+	return data, unmap, nil
+}
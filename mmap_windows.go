@@ -0,0 +1,45 @@
+//go:build windows
+
+package cdb
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// mmapFile maps the whole of f into memory read-only and returns the
+// mapped bytes along with a function that unmaps them.
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	if size == 0 {
+		return []byte{}, func() error { return nil }, nil
+	}
+
+	h, err := syscall.CreateFileMapping(syscall.Handle(f.Fd()), nil, syscall.PAGE_READONLY, uint32(size>>32), uint32(size), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	addr, err := syscall.MapViewOfFile(h, syscall.FILE_MAP_READ, 0, 0, uintptr(size))
+	if err != nil {
+		syscall.CloseHandle(h)
+		return nil, nil, err
+	}
+
+	data := (*[1 << 40]byte)(unsafe.Pointer(addr))[:size:size]
+
+	unmapped := false
+	unmap := func() error {
+		if unmapped {
+			return nil
+		}
+		unmapped = true
+		if err := syscall.UnmapViewOfFile(addr); err != nil {
+			syscall.CloseHandle(h)
+			return err
+		}
+		return syscall.CloseHandle(h)
+	}
+
+	return data, unmap, nil
+}
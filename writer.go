@@ -0,0 +1,436 @@
+package cdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// slot is a pending (hash, offset) pair for one of the 256 hash tables.
+// Writer accumulates these as records are added, and resolves them into
+// their final table position when the database is closed.
+type slot struct {
+	hash   uint64
+	offset uint64
+}
+
+// Writer builds a new CDB database. Records are appended with Put; the
+// database isn't valid to read until Close or Freeze has written out the
+// hash tables and index.
+type Writer struct {
+	writer     io.WriteSeeker
+	buf        *bufio.Writer
+	format     Format
+	hasher     func([]byte) uint32
+	hasherID   byte
+	checksum   bool
+	chd        bool
+	started    bool
+	pos        uint64
+	index      [256][]slot
+	chdEntries []chdEntry
+	chdSeen    map[string]bool
+
+	// file, path and tmpPath are only set for a Writer created by Create
+	// or CreateWithOptions: file is the open *.tmp sibling of path, which
+	// Close/Freeze fsync and atomically rename into place.
+	file    *os.File
+	path    string
+	tmpPath string
+}
+
+// Create creates path and returns a Writer over it, using the classic
+// (v1) format and the default cdb hash. Records are buffered and written
+// to a "*.tmp" sibling of path, which Close or Freeze fsyncs and
+// atomically renames into place, so a reader never observes a partially
+// written database at path.
+func Create(path string) (*Writer, error) {
+	return CreateWithOptions(path, Options{})
+}
+
+// CreateWithOptions is like Create, but lets the caller select the
+// on-disk format and hasher, as NewWriterWithOptions does.
+func CreateWithOptions(path string, options Options) (*Writer, error) {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := NewWriterWithOptions(f, nil, options)
+	if err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	w.file = f
+	w.path = path
+	w.tmpPath = tmpPath
+	return w, nil
+}
+
+// NewWriter returns a Writer over an existing io.WriteSeeker, using the
+// classic (v1) format. If hasher is nil, the default cdb hash is used.
+func NewWriter(writer io.WriteSeeker, hasher hash.Hash32) (*Writer, error) {
+	return NewWriterWithOptions(writer, hasher, Options{})
+}
+
+// NewWriterWithOptions is like NewWriter, but lets the caller select the
+// on-disk format. Options.Format of FormatAuto is treated as
+// FormatClassic.
+//
+// For a Format64 database, passing an explicit hasher here instead of
+// naming it via Options.HasherName still works for writing, but the
+// database records "cdb" as its hasher ID, so Open will not recognize it
+// and will fall back to CDBHashSum32 on read. Register the hasher with
+// RegisterHasher and pass its name through Options.HasherName instead so
+// it round-trips.
+func NewWriterWithOptions(writer io.WriteSeeker, hasher hash.Hash32, options Options) (*Writer, error) {
+	format := options.Format
+	if format == FormatAuto {
+		format = FormatClassic
+	}
+
+	hasherFunc := adaptHash32(hasher)
+	hasherID, _ := lookupHasherIDByName("cdb")
+	if hasherFunc == nil {
+		if options.HasherName != "" {
+			fn, ok := lookupHasherByName(options.HasherName)
+			if !ok {
+				return nil, fmt.Errorf("cdb: unknown hasher %q", options.HasherName)
+			}
+			hasherFunc = fn
+			hasherID, _ = lookupHasherIDByName(options.HasherName)
+		} else {
+			hasherFunc = CDBHashSum32
+		}
+	}
+
+	return &Writer{
+		writer:   writer,
+		buf:      bufio.NewWriter(writer),
+		format:   format,
+		hasher:   hasherFunc,
+		hasherID: hasherID,
+	}, nil
+}
+
+// ensureStarted reserves the file's header region on the first call,
+// once the format (including any UseCHDIndex override) is final, and
+// seeks past it so records can be written starting from there.
+func (w *Writer) ensureStarted() error {
+	if w.started {
+		return nil
+	}
+
+	if w.chd {
+		w.format = FormatCHD
+	}
+
+	headerSize := w.format.headerSize()
+	if _, err := w.writer.Seek(int64(headerSize), io.SeekStart); err != nil {
+		return err
+	}
+
+	w.pos = headerSize
+	w.started = true
+	return nil
+}
+
+// UseChecksum enables an opt-in integrity trailer: when enabled, Close
+// appends a SHA-256 digest of the whole file, followed by a trailer
+// marker, after the hash tables. OpenWithOptions or a New*AndOptions
+// constructor with Options.Verify set can then detect bit rot on a
+// long-lived read-only database.
+//
+// The writer passed to NewWriter must also implement io.ReaderAt for the
+// checksum to be computed; the *os.File returned by Create does.
+func (w *Writer) UseChecksum(enable bool) {
+	w.checksum = enable
+}
+
+// UseCHDIndex switches Close over to building a CHD (Compress-Hash-
+// Displace) perfect hash (not minimal) over the final key set instead of the
+// usual 256 probed hash tables, giving every successful Get a single
+// slot read instead of cdb's expected two probes.
+//
+// It must be called before the first Put, since it changes where in the
+// file records start; calling it afterward has no effect.
+func (w *Writer) UseCHDIndex(enable bool) {
+	w.chd = enable
+}
+
+// Put adds a key/value pair to the database. Keys are not required to be
+// unique; Get returns the first match written for a duplicate key. Under
+// UseCHDIndex, only the first copy of a repeated key is given a slot in
+// the minimal perfect hash, since a CHD bucket can't place two identical
+// (h1, h2) pairs into distinct slots; later copies are still written to
+// the data section but are unreachable, consistent with "first match
+// wins".
+func (w *Writer) Put(key, value []byte) error {
+	if err := w.ensureStarted(); err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(key)))
+	binary.LittleEndian.PutUint32(header[4:8], uint32(len(value)))
+
+	if _, err := w.buf.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.buf.Write(key); err != nil {
+		return err
+	}
+	if _, err := w.buf.Write(value); err != nil {
+		return err
+	}
+
+	if w.format == FormatCHD {
+		// A CHD bucket can place at most one key per distinct (h1, h2)
+		// pair, so a repeated key can never be displaced away from its
+		// own earlier copy; only the first copy is given a slot, which
+		// matches the "first match wins" semantics documented above.
+		if w.chdSeen == nil {
+			w.chdSeen = make(map[string]bool)
+		}
+		keyStr := string(key)
+		if !w.chdSeen[keyStr] {
+			w.chdSeen[keyStr] = true
+			keyCopy := make([]byte, len(key))
+			copy(keyCopy, key)
+			w.chdEntries = append(w.chdEntries, chdEntry{key: keyCopy, offset: w.pos})
+		}
+	} else {
+		h := w.hasher(key)
+		w.index[h&0xff] = append(w.index[h&0xff], slot{hash: uint64(h), offset: w.pos})
+	}
+
+	w.pos += uint64(8 + len(key) + len(value))
+	return nil
+}
+
+// Close writes out the index (a CHD index if UseCHDIndex was enabled,
+// otherwise the usual 256 hash tables), then commits the result.
+//
+// For a Writer returned by Create or CreateWithOptions, committing means
+// fsyncing the "*.tmp" file the records were buffered into and atomically
+// renaming it into place, so a reader never observes a partially written
+// database at the requested path; Close discards the *CDB that commit
+// could open on the result. For a Writer returned by NewWriter or
+// NewWriterWithOptions, committing just closes the writer, if it also
+// implements io.Closer.
+func (w *Writer) Close() error {
+	if err := w.finalize(); err != nil {
+		w.abort()
+		return err
+	}
+	_, err := w.commit()
+	return err
+}
+
+// Freeze is like Close, but for a Writer returned by Create or
+// CreateWithOptions: it finalizes and commits the database as Close does,
+// then opens and returns the result, saving the caller a separate Open
+// call. It returns an error if w wasn't created by Create or
+// CreateWithOptions, since there would be no path to open.
+func (w *Writer) Freeze() (*CDB, error) {
+	if w.file == nil {
+		return nil, fmt.Errorf("cdb: Freeze requires a Writer created by Create or CreateWithOptions")
+	}
+	if err := w.finalize(); err != nil {
+		w.abort()
+		return nil, err
+	}
+	return w.commit()
+}
+
+// abort closes and removes the "*.tmp" sibling file for a Writer created
+// by Create or CreateWithOptions, mirroring the cleanup CreateWithOptions
+// itself does on a failed construction. It is a no-op for a Writer over a
+// caller-supplied io.WriteSeeker, since there is no file for Close or
+// Freeze to own.
+func (w *Writer) abort() {
+	if w.file == nil {
+		return
+	}
+	w.file.Close()
+	os.Remove(w.tmpPath)
+}
+
+// finalize writes out the index: a CHD index if UseCHDIndex was enabled,
+// otherwise the usual 256 hash tables.
+func (w *Writer) finalize() error {
+	if err := w.ensureStarted(); err != nil {
+		return err
+	}
+
+	if w.format == FormatCHD {
+		return w.writeCHDIndex()
+	}
+	return w.writeProbedIndex()
+}
+
+// commit finishes writing w's underlying file. For a Writer backed by a
+// *.tmp sibling file (one created by Create or CreateWithOptions), it
+// fsyncs that file, atomically renames it into place, and opens the
+// result. For any other Writer, it just closes the writer, if it also
+// implements io.Closer.
+func (w *Writer) commit() (*CDB, error) {
+	if w.file == nil {
+		if closer, ok := w.writer.(io.Closer); ok {
+			return nil, closer.Close()
+		}
+		return nil, nil
+	}
+
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	if err := w.file.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(w.tmpPath, w.path); err != nil {
+		return nil, err
+	}
+
+	return OpenWithOptions(w.path, Options{Format: w.format})
+}
+
+// writeProbedIndex writes the classic/Format64 index: 256 probed hash
+// tables followed by the fixed-size index pointing at them.
+func (w *Writer) writeProbedIndex() error {
+	header := make([]byte, w.format.indexSize())
+
+	for i, bucket := range w.index {
+		if len(bucket) == 0 {
+			continue
+		}
+
+		nslots := uint64(len(bucket)) * 2
+		table := make([]slot, nslots)
+
+		for _, s := range bucket {
+			idx := (s.hash >> 8) % nslots
+			for table[idx].hash != 0 {
+				idx = (idx + 1) % nslots
+			}
+			table[idx] = s
+		}
+
+		start := w.pos
+		slotSize := w.format.slotSize()
+		buf := make([]byte, nslots*slotSize)
+		for j, s := range table {
+			off := uint64(j) * slotSize
+			if w.format == Format64 {
+				binary.LittleEndian.PutUint64(buf[off:off+8], s.hash)
+				binary.LittleEndian.PutUint64(buf[off+8:off+16], s.offset)
+			} else {
+				binary.LittleEndian.PutUint32(buf[off:off+4], uint32(s.hash))
+				binary.LittleEndian.PutUint32(buf[off+4:off+8], uint32(s.offset))
+			}
+		}
+		if _, err := w.buf.Write(buf); err != nil {
+			return err
+		}
+
+		if w.format == Format64 {
+			off := i * 16
+			binary.LittleEndian.PutUint64(header[off:off+8], start)
+			binary.LittleEndian.PutUint64(header[off+8:off+16], nslots)
+		} else {
+			off := i * 8
+			binary.LittleEndian.PutUint32(header[off:off+4], uint32(start))
+			binary.LittleEndian.PutUint32(header[off+4:off+8], uint32(nslots))
+		}
+
+		w.pos += nslots * slotSize
+	}
+
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := w.writer.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if w.format == Format64 {
+		magic := make([]byte, v2MagicSize)
+		copy(magic, v2MagicPrefix[:])
+		magic[v2HashIDOffset] = w.hasherID
+		if _, err := w.writer.Write(magic); err != nil {
+			return err
+		}
+	}
+	if _, err := w.writer.Write(header); err != nil {
+		return err
+	}
+
+	if w.checksum {
+		if err := w.writeChecksumTrailer(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeCHDIndex writes the CHD index built from w.chdEntries after the
+// data records, then the small fixed header pointing at it.
+func (w *Writer) writeCHDIndex() error {
+	idx, err := buildCHDIndex(w.hasher, w.chdEntries)
+	if err != nil {
+		return err
+	}
+
+	sectionOffset := w.pos
+	section := make([]byte, 16+len(idx.seeds)*4+len(idx.slots)*8)
+	binary.LittleEndian.PutUint64(section[0:8], idx.r)
+	binary.LittleEndian.PutUint64(section[8:16], idx.m)
+
+	off := 16
+	for _, s := range idx.seeds {
+		binary.LittleEndian.PutUint32(section[off:off+4], s)
+		off += 4
+	}
+	for _, s := range idx.slots {
+		binary.LittleEndian.PutUint64(section[off:off+8], s)
+		off += 8
+	}
+
+	if _, err := w.buf.Write(section); err != nil {
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	w.pos += uint64(len(section))
+
+	header := make([]byte, chdHeaderSize)
+	copy(header, chdMagicPrefix[:])
+	header[chdHashIDOffset] = w.hasherID
+	binary.LittleEndian.PutUint64(header[chdMagicSize:chdMagicSize+8], sectionOffset)
+	binary.LittleEndian.PutUint64(header[chdMagicSize+8:chdMagicSize+16], uint64(len(section)))
+
+	if _, err := w.writer.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.writer.Write(header); err != nil {
+		return err
+	}
+
+	if w.checksum {
+		if err := w.writeChecksumTrailer(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
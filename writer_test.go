@@ -0,0 +1,114 @@
+package cdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCreateFreezeRoundTrip checks that a database built with Create and
+// Freeze can be read back with the values it was given, and that the
+// "*.tmp" sibling file Create writes into is gone once Freeze commits.
+func TestCreateFreezeRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := w.Put([]byte("one"), []byte("1")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := w.Put([]byte("two"), []byte("2")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	db, err := w.Freeze()
+	if err != nil {
+		t.Fatalf("Freeze: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("tmp file still present after Freeze: err=%v", err)
+	}
+
+	value, err := db.Get([]byte("one"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(value) != "1" {
+		t.Fatalf("Get(one) = %q, want %q", value, "1")
+	}
+
+	value, err = db.Get([]byte("missing"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if value != nil {
+		t.Fatalf("Get(missing) = %q, want nil", value)
+	}
+}
+
+// TestPutDuplicateKeyReturnsFirstMatch checks the documented "first match
+// wins" semantics for a repeated key in the classic/Format64 path.
+func TestPutDuplicateKeyReturnsFirstMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := w.Put([]byte("k"), []byte("first")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := w.Put([]byte("k"), []byte("second")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	db, err := w.Freeze()
+	if err != nil {
+		t.Fatalf("Freeze: %v", err)
+	}
+	defer db.Close()
+
+	value, err := db.Get([]byte("k"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(value) != "first" {
+		t.Fatalf("Get(k) = %q, want %q", value, "first")
+	}
+}
+
+// TestCloseOnFinalizeFailureCleansUpTmpFile checks that a Writer created
+// by Create removes its "*.tmp" sibling and releases the file handle
+// when finalize fails, rather than leaking both.
+func TestCloseOnFinalizeFailureCleansUpTmpFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := w.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// Close the backing file out from under the Writer so finalize's
+	// writes fail, simulating any other finalize error.
+	if err := w.file.Close(); err != nil {
+		t.Fatalf("closing backing file early: %v", err)
+	}
+
+	if err := w.Close(); err == nil {
+		t.Fatal("Close with a broken backing file unexpectedly succeeded")
+	}
+
+	if _, err := os.Stat(w.tmpPath); !os.IsNotExist(err) {
+		t.Fatalf("tmp file still present after a failed Close: err=%v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("final path unexpectedly created after a failed Close: err=%v", err)
+	}
+}